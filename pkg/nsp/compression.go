@@ -0,0 +1,233 @@
+package nsp
+
+import (
+	"fmt"
+	"io"
+	"nca-to-nsp/pkg/progress"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ncaZstdSuffix is appended to an entry's stored name when it is written
+// compressed, identifying it as an NSZ-style payload to the Reader.
+const ncaZstdSuffix = ".ncz"
+
+// Compression identifies the codec applied to each entry's data before it is
+// written to the NSP.
+type Compression int
+
+const (
+	// CompressionNone stores each entry's data as-is. This is the default.
+	CompressionNone Compression = iota
+	// CompressionZstd streams each entry through a zstd encoder, producing
+	// an NSZ-style archive. Stored filenames gain a ".ncz" suffix.
+	CompressionZstd
+)
+
+// storedName returns the filename to record in the PFS0 string table for
+// file, accounting for the ".ncz" suffix compressed entries receive.
+func (b *Builder) storedName(file *partitionEntry) string {
+	if b.Compression == CompressionZstd {
+		return file.name + ncaZstdSuffix
+	}
+	return file.name
+}
+
+// offsetWriter adapts a writeFunc to the io.Writer a zstd.Encoder expects,
+// tracking how many bytes have been written so far so the encoder's output
+// lands at increasing absolute offsets in the logical NSP.
+type offsetWriter struct {
+	write  writeFunc
+	offset uint64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	if err := w.write(w.offset, p); err != nil {
+		return 0, err
+	}
+	w.offset += uint64(len(p))
+	return len(p), nil
+}
+
+// buildCompressed writes the NSP with every entry compressed via zstd.
+// Because compressed sizes are not known before encoding, it reserves space
+// for the header, streams every entry's compressed data immediately after
+// it, and then patches the header in place once the real sizes and offsets
+// are known.
+func (b *Builder) buildCompressed(write writeFunc) error {
+	headerSize := uint64(len(b.generateHeader()))
+
+	if err := write(0, make([]byte, headerSize)); err != nil {
+		return fmt.Errorf("failed to reserve header: %w", err)
+	}
+
+	var totalSize uint64
+	for _, file := range b.partEntries {
+		totalSize += file.size
+	}
+
+	var processedSize uint64
+	buffer := make([]byte, b.BufferSize)
+	offset := headerSize
+
+	for i, file := range b.partEntries {
+		if b.ShowProgress {
+			fmt.Printf(
+				"Processing (%d/%d): %s\n",
+				i+1,
+				len(b.partEntries),
+				file.name,
+			)
+		}
+
+		entry := &b.partEntries[i]
+
+		compressedSize, err := b.compressEntry(
+			entry,
+			buffer,
+			offset,
+			write,
+			&processedSize,
+			totalSize,
+		)
+		if err != nil {
+			return err
+		}
+
+		entry.size = compressedSize
+		offset += compressedSize
+	}
+
+	// Now that every entry's real (compressed) size is known, regenerate the
+	// header - its length is unchanged, since that depends only on entry
+	// count and filenames, not data sizes - and patch it in place.
+	header := b.generateHeader()
+	if uint64(len(header)) != headerSize {
+		return fmt.Errorf(
+			"internal error: header size changed from %d to %d bytes "+
+				"while compressing",
+			headerSize,
+			len(header),
+		)
+	}
+
+	if err := write(0, header); err != nil {
+		return fmt.Errorf("failed to patch header: %w", err)
+	}
+
+	return nil
+}
+
+// compressEntry streams fileInfo's data through a zstd encoder into write at
+// the given absolute offset, hashing the compressed bytes as they are
+// produced, and returns the number of compressed bytes written.
+func (b *Builder) compressEntry(
+	fileInfo *partitionEntry,
+	buffer []byte,
+	offset uint64,
+	write writeFunc,
+	processedSize *uint64,
+	totalSize uint64,
+) (uint64, error) {
+	src := fileInfo.reader
+	if src == nil {
+		inFile, err := os.Open(fileInfo.path)
+		if err != nil {
+			return 0, fmt.Errorf(
+				"failed to open input file %s: %w",
+				fileInfo.path,
+				err,
+			)
+		}
+		defer inFile.Close()
+		src = inFile
+	}
+
+	hasher, err := b.HashAlgorithm.newHash()
+	if err != nil {
+		return 0, fmt.Errorf(
+			"failed to initialize hash for %s: %w",
+			fileInfo.label(),
+			err,
+		)
+	}
+
+	sink := &offsetWriter{write: write, offset: offset}
+	encoder, err := zstd.NewWriter(io.MultiWriter(sink, hasher))
+	if err != nil {
+		return 0, fmt.Errorf(
+			"failed to initialize zstd encoder for %s: %w",
+			fileInfo.label(),
+			err,
+		)
+	}
+
+	bytesRead := uint64(0)
+
+	for {
+		n, err := src.Read(buffer)
+		if err != nil && err != io.EOF {
+			return 0, fmt.Errorf(
+				"error reading input %s: %w",
+				fileInfo.label(),
+				err,
+			)
+		}
+
+		if n == 0 {
+			break
+		}
+
+		if _, err := encoder.Write(buffer[:n]); err != nil {
+			return 0, fmt.Errorf(
+				"error compressing %s: %w",
+				fileInfo.label(),
+				err,
+			)
+		}
+
+		bytesRead += uint64(n)
+		*processedSize += uint64(n)
+
+		if b.renderer != nil {
+			b.renderer.Update(fileInfo.name, progress.Line{
+				Action:  "packing",
+				Name:    fileInfo.name,
+				Current: bytesRead,
+				Total:   fileInfo.size,
+			})
+			b.renderer.Update(totalLineID, progress.Line{
+				Action:  "packing",
+				Name:    "total",
+				Current: *processedSize,
+				Total:   totalSize,
+			})
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		return 0, fmt.Errorf(
+			"error finalizing compressed stream for %s: %w",
+			fileInfo.label(),
+			err,
+		)
+	}
+
+	if b.renderer != nil {
+		b.renderer.Done(fileInfo.name)
+	}
+
+	if bytesRead != fileInfo.size {
+		return 0, fmt.Errorf(
+			"size mismatch for %s during read: expected %d bytes, read %d bytes",
+			fileInfo.label(),
+			fileInfo.size,
+			bytesRead,
+		)
+	}
+
+	fileInfo.digest = hasher.Sum(nil)
+
+	return sink.offset - offset, nil
+}
@@ -0,0 +1,94 @@
+package nsp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuilderCompressedRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "a.bin")
+	content := []byte("hello compressed world, hello compressed world")
+	if err := os.WriteFile(srcPath, content, 0o644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	nspPath := filepath.Join(dir, "out.nsz")
+	b := &Builder{
+		OutputPath:  nspPath,
+		BufferSize:  DefaultBufferSize,
+		Compression: CompressionZstd,
+	}
+	if err := b.AddFile(srcPath); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	r, err := OpenReader(nspPath)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer r.Close()
+
+	entries := r.Entries()
+	if len(entries) != 1 || entries[0].Name != "a.bin"+ncaZstdSuffix {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	rc, err := r.Open(entries[0].Name)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Fatalf("got %q, want %q", got, content)
+	}
+}
+
+func TestBuilderCompressedManifestVerify(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "a.bin")
+	content := []byte("hello compressed world, hello compressed world")
+	if err := os.WriteFile(srcPath, content, 0o644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	nspPath := filepath.Join(dir, "out.nsz")
+	b := &Builder{
+		OutputPath:  nspPath,
+		BufferSize:  DefaultBufferSize,
+		Compression: CompressionZstd,
+	}
+	if err := b.AddFile(srcPath); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	manifest, err := b.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	if len(manifest.Entries) != 1 || manifest.Entries[0].Name != "a.bin"+ncaZstdSuffix {
+		t.Fatalf("unexpected manifest entries: %+v", manifest.Entries)
+	}
+
+	v := &Verifier{Path: nspPath}
+	mismatches, err := v.Verify(manifest)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches: %+v", mismatches)
+	}
+}
@@ -0,0 +1,415 @@
+package nsp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// HashAlgorithm identifies the digest algorithm used when building a
+// Manifest.
+type HashAlgorithm int
+
+const (
+	// HashSHA256 digests each file with SHA-256. This is the default.
+	HashSHA256 HashAlgorithm = iota
+	// HashBLAKE2b256 digests each file with 256-bit BLAKE2b.
+	HashBLAKE2b256
+)
+
+// prefix returns the digest string prefix used for this algorithm, e.g.
+// "sha256:".
+func (a HashAlgorithm) prefix() string {
+	switch a {
+	case HashBLAKE2b256:
+		return "blake2b256:"
+	default:
+		return "sha256:"
+	}
+}
+
+// newHash returns a fresh hash.Hash for this algorithm.
+func (a HashAlgorithm) newHash() (hash.Hash, error) {
+	switch a {
+	case HashBLAKE2b256:
+		return blake2b.New256(nil)
+	default:
+		return sha256.New(), nil
+	}
+}
+
+// parseDigest splits a "<algorithm>:<hex>" digest string, as produced by
+// ManifestEntry.Digest, into its algorithm and hex-encoded sum.
+func parseDigest(digest string) (HashAlgorithm, string, error) {
+	switch {
+	case strings.HasPrefix(digest, HashSHA256.prefix()):
+		return HashSHA256, strings.TrimPrefix(digest, HashSHA256.prefix()), nil
+	case strings.HasPrefix(digest, HashBLAKE2b256.prefix()):
+		return HashBLAKE2b256, strings.TrimPrefix(digest, HashBLAKE2b256.prefix()), nil
+	default:
+		return 0, "", fmt.Errorf("unrecognized digest format %q", digest)
+	}
+}
+
+// ManifestEntry describes the digest, size, and stored name of a single
+// partition entry, modeled on OCI content descriptors.
+type ManifestEntry struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      uint64 `json:"size"`
+	Name      string `json:"name"`
+}
+
+// Manifest is a content-addressable description of an NSP's contents,
+// produced by Builder.Manifest and consumed by Verifier.
+type Manifest struct {
+	// Digest of the concatenation of every entry's digest, in entry order.
+	Digest  string          `json:"digest"`
+	Entries []ManifestEntry `json:"entries"`
+}
+
+// Manifest returns a content-addressable description of the files written
+// by the most recent call to Build. It must be called after Build has
+// completed successfully.
+func (b *Builder) Manifest() (Manifest, error) {
+	if len(b.partEntries) == 0 {
+		return Manifest{}, fmt.Errorf("no files have been built yet")
+	}
+
+	prefix := b.HashAlgorithm.prefix()
+
+	topHasher, err := b.HashAlgorithm.newHash()
+	if err != nil {
+		return Manifest{}, fmt.Errorf(
+			"failed to initialize top-level hash: %w",
+			err,
+		)
+	}
+
+	entries := make([]ManifestEntry, len(b.partEntries))
+	for i, file := range b.partEntries {
+		if file.digest == nil {
+			return Manifest{}, fmt.Errorf(
+				"no digest recorded for %s; was Build called?",
+				file.name,
+			)
+		}
+
+		entries[i] = ManifestEntry{
+			MediaType: "application/vnd.nca-to-nsp.partition.v1+" +
+				strings.TrimSuffix(prefix, ":"),
+			Digest: prefix + hex.EncodeToString(file.digest),
+			Size:   file.size,
+			Name:   b.storedName(&file),
+		}
+
+		topHasher.Write(file.digest)
+	}
+
+	return Manifest{
+		Digest:  prefix + hex.EncodeToString(topHasher.Sum(nil)),
+		Entries: entries,
+	}, nil
+}
+
+// WriteManifest writes the Manifest for the most recent Build as indented
+// JSON to w.
+func (b *Builder) WriteManifest(w io.Writer) error {
+	manifest, err := b.Manifest()
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+
+	return nil
+}
+
+// Verifier re-hashes the contents of an existing NSP against a Manifest to
+// detect corruption.
+type Verifier struct {
+	// Path to the NSP file to verify. If no file exists at Path, Verify also
+	// looks for sequentially numbered split parts (Path.00, Path.01, ...), as
+	// written by a Builder with SplitSize set, and verifies against their
+	// concatenation.
+	Path string
+}
+
+// Mismatch describes a single manifest entry that failed verification.
+type Mismatch struct {
+	Name     string
+	Expected string
+	Actual   string
+}
+
+// headerEntry is the subset of a parsed partition entry that Verifier needs.
+type headerEntry struct {
+	name       string
+	dataOffset uint64
+	size       uint64
+}
+
+// readPartitionEntries parses the PFS0 header (as produced by
+// Builder.generateHeader) from r and returns the absolute offset of the data
+// section along with every partition entry.
+func readPartitionEntries(r io.Reader) (uint64, []headerEntry, error) {
+	var meta [0x10]byte
+	if _, err := io.ReadFull(r, meta[:]); err != nil {
+		return 0, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	if string(meta[0:4]) != PFS0Magic {
+		return 0, nil, fmt.Errorf("not a PFS0 file (bad magic)")
+	}
+
+	entryCount := binary.LittleEndian.Uint32(meta[4:8])
+	stringTableSize := binary.LittleEndian.Uint32(meta[8:12])
+
+	table := make([]byte, int(entryCount)*0x18)
+	if _, err := io.ReadFull(r, table); err != nil {
+		return 0, nil, fmt.Errorf("failed to read partition table: %w", err)
+	}
+
+	stringTable := make([]byte, stringTableSize)
+	if _, err := io.ReadFull(r, stringTable); err != nil {
+		return 0, nil, fmt.Errorf("failed to read string table: %w", err)
+	}
+
+	entries := make([]headerEntry, entryCount)
+	for i := range entries {
+		pos := i * 0x18
+		dataOffset := binary.LittleEndian.Uint64(table[pos:])
+		size := binary.LittleEndian.Uint64(table[pos+8:])
+		stringOffset := binary.LittleEndian.Uint32(table[pos+16:])
+
+		if stringOffset >= uint32(len(stringTable)) {
+			return 0, nil, fmt.Errorf(
+				"malformed header: entry %d string offset %d is out of bounds",
+				i,
+				stringOffset,
+			)
+		}
+
+		rest := stringTable[stringOffset:]
+		end := bytes.IndexByte(rest, 0)
+		if end < 0 {
+			end = len(rest)
+		}
+
+		entries[i] = headerEntry{
+			name:       string(rest[:end]),
+			dataOffset: dataOffset,
+			size:       size,
+		}
+	}
+
+	dataBaseOffset := uint64(0x10+len(table)) + uint64(stringTableSize)
+
+	return dataBaseOffset, entries, nil
+}
+
+// openSplitOrSingle opens the NSP at path for reading, as a single file if
+// one exists there, or as the concatenation of its sequentially numbered
+// split parts (path.00, path.01, ...) otherwise. The returned closeFn must be
+// called once the io.ReaderAt is no longer needed.
+func openSplitOrSingle(path string) (io.ReaderAt, int64, func() error, error) {
+	if info, err := os.Stat(path); err == nil {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return f, info.Size(), f.Close, nil
+	}
+
+	var parts []*os.File
+	var sizes []int64
+
+	for i := 0; ; i++ {
+		partPath := fmt.Sprintf("%s.%02d", path, i)
+
+		info, err := os.Stat(partPath)
+		if err != nil {
+			if i == 0 {
+				return nil, 0, nil, fmt.Errorf(
+					"no such file %s (or split parts %s.00, %s.01, ...)",
+					path,
+					path,
+					path,
+				)
+			}
+			break
+		}
+
+		f, err := os.Open(partPath)
+		if err != nil {
+			for _, opened := range parts {
+				opened.Close()
+			}
+			return nil, 0, nil, err
+		}
+
+		parts = append(parts, f)
+		sizes = append(sizes, info.Size())
+	}
+
+	sr := &splitReaderAt{parts: parts, sizes: sizes}
+
+	var total int64
+	for _, size := range sizes {
+		total += size
+	}
+
+	return sr, total, sr.Close, nil
+}
+
+// splitReaderAt presents a sequence of part files, as written by a Builder
+// with SplitSize set, as a single contiguous io.ReaderAt over their logical
+// concatenation.
+type splitReaderAt struct {
+	parts []*os.File
+	sizes []int64
+}
+
+// locate returns the part index and within-part offset corresponding to the
+// given offset into the logical concatenation.
+func (s *splitReaderAt) locate(offset int64) (int, int64, bool) {
+	for i, size := range s.sizes {
+		if offset < size {
+			return i, offset, true
+		}
+		offset -= size
+	}
+	return 0, 0, false
+}
+
+func (s *splitReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	var total int
+	for len(p) > 0 {
+		idx, partOffset, ok := s.locate(offset)
+		if !ok {
+			if total == 0 {
+				return 0, io.EOF
+			}
+			return total, io.ErrUnexpectedEOF
+		}
+
+		chunk := s.sizes[idx] - partOffset
+		if chunk > int64(len(p)) {
+			chunk = int64(len(p))
+		}
+
+		n, err := s.parts[idx].ReadAt(p[:chunk], partOffset)
+		total += n
+		p = p[n:]
+		offset += int64(n)
+
+		if err != nil && err != io.EOF {
+			return total, err
+		}
+		if int64(n) < chunk {
+			return total, io.ErrUnexpectedEOF
+		}
+	}
+
+	return total, nil
+}
+
+// Close closes every part file opened by openSplitOrSingle.
+func (s *splitReaderAt) Close() error {
+	var firstErr error
+	for _, f := range s.parts {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Verify re-hashes every entry described by manifest against the NSP at
+// v.Path (or its split parts, see Verifier.Path) and returns the entries
+// whose digests do not match. A nil slice with a nil error means every
+// manifest entry is present with a matching digest; entries in the NSP that
+// the manifest does not list are not reported.
+func (v *Verifier) Verify(manifest Manifest) ([]Mismatch, error) {
+	ra, size, closeFn, err := openSplitOrSingle(v.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NSP %s: %w", v.Path, err)
+	}
+	defer closeFn()
+
+	dataBaseOffset, entries, err := readPartitionEntries(
+		io.NewSectionReader(ra, 0, size),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NSP %s: %w", v.Path, err)
+	}
+
+	byName := make(map[string]headerEntry, len(entries))
+	for _, entry := range entries {
+		byName[entry.name] = entry
+	}
+
+	var mismatches []Mismatch
+	for _, want := range manifest.Entries {
+		entry, ok := byName[want.Name]
+		if !ok {
+			mismatches = append(mismatches, Mismatch{
+				Name:     want.Name,
+				Expected: want.Digest,
+				Actual:   "missing",
+			})
+			continue
+		}
+
+		algo, wantSum, err := parseDigest(want.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("manifest entry %s: %w", want.Name, err)
+		}
+
+		hasher, err := algo.newHash()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to initialize hash for %s: %w",
+				want.Name,
+				err,
+			)
+		}
+
+		section := io.NewSectionReader(
+			ra,
+			int64(dataBaseOffset+entry.dataOffset),
+			int64(entry.size),
+		)
+		if _, err := io.Copy(hasher, section); err != nil {
+			return nil, fmt.Errorf(
+				"failed to read partition %s: %w",
+				want.Name,
+				err,
+			)
+		}
+
+		actualSum := hex.EncodeToString(hasher.Sum(nil))
+		if actualSum != wantSum {
+			mismatches = append(mismatches, Mismatch{
+				Name:     want.Name,
+				Expected: want.Digest,
+				Actual:   algo.prefix() + actualSum,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
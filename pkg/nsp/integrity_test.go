@@ -0,0 +1,79 @@
+package nsp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestAndVerifierRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(srcPath, []byte("hello world"), 0o644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	nspPath := filepath.Join(dir, "out.nsp")
+	b := &Builder{OutputPath: nspPath, BufferSize: DefaultBufferSize}
+	if err := b.AddFile(srcPath); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	manifest, err := b.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+
+	v := &Verifier{Path: nspPath}
+	mismatches, err := v.Verify(manifest)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches: %+v", mismatches)
+	}
+}
+
+func TestVerifierAcceptsSplitParts(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(srcPath, make([]byte, 100), 0o644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	nspPath := filepath.Join(dir, "out.nsp")
+	b := &Builder{
+		OutputPath: nspPath,
+		BufferSize: DefaultBufferSize,
+		// Small enough that the entry's data spans several parts: the
+		// 48-byte header and the first 16 data bytes fill part .00.
+		SplitSize: 64,
+	}
+	if err := b.AddFile(srcPath); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if _, err := os.Stat(nspPath + ".00"); err != nil {
+		t.Fatalf("expected split part %s.00 to exist: %v", nspPath, err)
+	}
+
+	manifest, err := b.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+
+	v := &Verifier{Path: nspPath}
+	mismatches, err := v.Verify(manifest)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches: %+v", mismatches)
+	}
+}
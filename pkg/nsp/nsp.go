@@ -4,17 +4,24 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"nca-to-nsp/pkg/progress"
 	"os"
 	"sort"
-	"strings"
-	"time"
 )
 
+// totalLineID identifies the aggregate progress line, kept separate from the
+// per-entry lines (which are keyed by entry name).
+const totalLineID = ""
+
 const (
 	// Magic number that identifies the PFS0 file format
 	PFS0Magic = "PFS0"
 	// Default buffer size (in bytes) for file I/O operations
 	DefaultBufferSize = 4096
+	// DefaultSplitSize is a part size (in bytes) for use as Builder.SplitSize.
+	// It matches the maximum file size supported by FAT32, which many Switch
+	// SD cards use. Builder.SplitSize itself defaults to zero (no splitting).
+	DefaultSplitSize = 4*1024*1024*1024 - 1
 )
 
 // Builder provides functionality for creating Nintendo Submission Package (NSP)
@@ -34,11 +41,31 @@ type Builder struct {
 	// Progress update frequency in milliseconds
 	ProgressUpdateFrequency int
 
-	// Track last output length for clean line clearing
-	lastProgressWidth int
+	// Maximum size, in bytes, of a single output part. When the logical NSP
+	// would exceed this size, it is written as sequentially numbered parts
+	// (OutputPath.00, OutputPath.01, ...) instead. Zero disables splitting.
+	// With Compression set, the final size is not known before writing, so a
+	// nonzero SplitSize always produces parts.
+	SplitSize uint64
+
+	// Digest algorithm used to record per-file hashes while building, for
+	// later retrieval via Manifest. Defaults to HashSHA256.
+	HashAlgorithm HashAlgorithm
+
+	// Compression codec applied to each entry's data before it is written.
+	// Defaults to CompressionNone.
+	Compression Compression
 
 	// The collection of files to be included in the NSP
 	partEntries []partitionEntry
+
+	// Open part files, keyed by part index, used while a Build is in
+	// progress
+	partFiles map[int]*os.File
+
+	// Live progress display for the current Build, non-nil only while
+	// ShowProgress is true and a build is in progress
+	renderer *progress.Renderer
 }
 
 // partitionEntry contains metadata about a file to be included in the NSP
@@ -57,6 +84,15 @@ type partitionEntry struct {
 
 	// Offset of this file's name in the string table
 	stringOffset uint32
+
+	// Digest of the entry's data as stored in the NSP (the compressed bytes
+	// when Compression is set), recorded once it has been written. Populated
+	// by copyEntry or compressEntry using Builder.HashAlgorithm.
+	digest []byte
+
+	// Source of the entry's data when it was added via AddReader instead of
+	// AddFile. Takes precedence over path when set.
+	reader io.Reader
 }
 
 // AddFile adds a file to be included in the NSP
@@ -85,17 +121,41 @@ func (b *Builder) AddFiles(paths []string) error {
 	return nil
 }
 
-// Build creates the NSP file with all the added files.
+// AddReader adds an entry whose contents are produced by r instead of read
+// from disk, letting callers stream data (e.g. an HTTP body or an
+// on-the-fly-decrypted NCA) without first materializing a temporary file.
+// size must be known up front, since the PFS0 header is generated before any
+// entry's data is copied.
+func (b *Builder) AddReader(name string, size uint64, r io.Reader) error {
+	b.partEntries = append(b.partEntries, partitionEntry{
+		name:   name,
+		size:   size,
+		reader: r,
+	})
+
+	return nil
+}
+
+// writeFunc writes data at the given absolute offset within the logical
+// (unsplit) NSP.
+type writeFunc func(offset uint64, data []byte) error
+
+// Build creates the NSP file with all the added files, writing it as
+// sequentially numbered parts instead of a single file if SplitSize is set
+// and the NSP would exceed it.
 func (b *Builder) Build() error {
-	if len(b.partEntries) == 0 {
-		return fmt.Errorf("no input files provided")
+	logicalSize := uint64(len(b.generateHeader()))
+	for _, file := range b.partEntries {
+		logicalSize += file.size
 	}
 
-	sort.Slice(b.partEntries, func(i, j int) bool {
-		return b.partEntries[i].name < b.partEntries[j].name
-	})
+	if b.SplitSize > 0 &&
+		(b.Compression != CompressionNone || logicalSize > b.SplitSize) {
+		b.partFiles = make(map[int]*os.File)
+		defer b.closePartFiles()
 
-	header := b.generateHeader()
+		return b.build(b.writeSpanning)
+	}
 
 	outFile, err := os.Create(b.OutputPath)
 	if err != nil {
@@ -107,17 +167,60 @@ func (b *Builder) Build() error {
 	}
 	defer outFile.Close()
 
-	bytesWritten, err := outFile.Write(header)
-	if err != nil {
+	return b.BuildTo(outFile)
+}
+
+// BuildTo writes the NSP to w instead of to OutputPath, seeking to the
+// correct position for the header and for each entry's data. Unlike Build,
+// it writes to a single sink and does not honor SplitSize, since splitting
+// requires multiple underlying files.
+func (b *Builder) BuildTo(w io.WriteSeeker) error {
+	return b.build(func(offset uint64, data []byte) error {
+		if _, err := w.Seek(int64(offset), io.SeekStart); err != nil {
+			return fmt.Errorf("failed to seek in output: %w", err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write to output: %w", err)
+		}
+		return nil
+	})
+}
+
+// build sorts the entries, sets up progress tracking, and delegates to
+// buildStored or buildCompressed depending on Builder.Compression.
+func (b *Builder) build(write writeFunc) error {
+	if len(b.partEntries) == 0 {
+		return fmt.Errorf("no input files provided")
+	}
+
+	sort.Slice(b.partEntries, func(i, j int) bool {
+		return b.partEntries[i].name < b.partEntries[j].name
+	})
+
+	if b.ShowProgress {
+		fmt.Printf("Building NSP: %s\n", b.OutputPath)
+		b.renderer = progress.NewRenderer(b.ProgressUpdateFrequency)
+		defer func() {
+			b.renderer.Finish()
+			b.renderer = nil
+		}()
+	}
+
+	if b.Compression == CompressionZstd {
+		return b.buildCompressed(write)
+	}
+
+	return b.buildStored(write)
+}
+
+// buildStored generates the header up front (entry sizes are already known)
+// and copies every entry's data using write, which places bytes at the
+// correct absolute offset within the logical NSP.
+func (b *Builder) buildStored(write writeFunc) error {
+	header := b.generateHeader()
+
+	if err := write(0, header); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
-	} else if bytesWritten != len(header) {
-		return fmt.Errorf(
-			"size mismatch for file %s during write: "+
-				"expected %d bytes, wrote %d bytes",
-			b.OutputPath,
-			len(header),
-			bytesWritten,
-		)
 	}
 
 	var totalSize uint64
@@ -125,14 +228,9 @@ func (b *Builder) Build() error {
 		totalSize += file.size
 	}
 
-	// Initialize progress tracking
 	var processedSize uint64
 	buffer := make([]byte, b.BufferSize)
 
-	if b.ShowProgress {
-		fmt.Printf("Building NSP: %s\n", b.OutputPath)
-	}
-
 	for i, file := range b.partEntries {
 		if b.ShowProgress {
 			fmt.Printf(
@@ -143,11 +241,7 @@ func (b *Builder) Build() error {
 			)
 		}
 
-		err := b.copyFileToNSP(outFile, file, buffer, &processedSize, totalSize)
-		if b.ShowProgress {
-			fmt.Print("\r" + strings.Repeat(" ", 80) + "\r")
-		}
-		if err != nil {
+		if err := b.copyEntry(&b.partEntries[i], buffer, &processedSize, totalSize, write); err != nil {
 			return err
 		}
 	}
@@ -166,7 +260,7 @@ func (b *Builder) Build() error {
 func (b *Builder) generateHeader() []byte {
 	stringTableSize := 0
 	for _, file := range b.partEntries {
-		stringTableSize += len(file.name) + 1 // +1 for null terminator
+		stringTableSize += len(b.storedName(&file)) + 1 // +1 for null terminator
 	}
 
 	// Magic(4) + EntryCount(4) + StringTableSize(4) + Reserved(4)
@@ -234,7 +328,7 @@ func (b *Builder) generateHeader() []byte {
 		)
 		file.stringOffset = stringOffset
 		stringOffset += uint32(
-			len(file.name) + 1, // +1 for null terminator
+			len(b.storedName(file)) + 1, // +1 for null terminator
 		)
 		headerPosition += 4
 
@@ -247,7 +341,7 @@ func (b *Builder) generateHeader() []byte {
 	stringTableOffset := headerMetadataSize + partitionTableSize
 	for _, entry := range b.partEntries {
 		nameOffset := stringTableOffset + int(entry.stringOffset)
-		copy(header[nameOffset:], entry.name)
+		copy(header[nameOffset:], b.storedName(&entry))
 		// The buffer is already filled with zeros, so null terminators are
 		// implicit
 	}
@@ -255,50 +349,59 @@ func (b *Builder) generateHeader() []byte {
 	return header
 }
 
-// copyFileToNSP copies a file to the NSP output at the position indicated by
-// its dataOffset.
-func (b *Builder) copyFileToNSP(
-	outFile *os.File,
-	fileInfo partitionEntry,
+// label returns the identifier to use for this entry in error messages: its
+// source path for file-backed entries, or its stored name for reader-backed
+// ones (which have no path).
+func (fileInfo *partitionEntry) label() string {
+	if fileInfo.reader != nil {
+		return fileInfo.name
+	}
+	return fileInfo.path
+}
+
+// copyEntry copies a single entry's data to the NSP output using write, at
+// the position indicated by its dataOffset. The entry's contents are teed
+// through Builder.HashAlgorithm and recorded in fileInfo.digest as they are
+// copied.
+func (b *Builder) copyEntry(
+	fileInfo *partitionEntry,
 	buffer []byte,
 	processedSize *uint64,
 	totalSize uint64,
+	write writeFunc,
 ) error {
-	inFile, err := os.Open(fileInfo.path)
-	if err != nil {
-		return fmt.Errorf(
-			"failed to open input file %s: %w",
-			fileInfo.path,
-			err,
-		)
+	src := fileInfo.reader
+	if src == nil {
+		inFile, err := os.Open(fileInfo.path)
+		if err != nil {
+			return fmt.Errorf(
+				"failed to open input file %s: %w",
+				fileInfo.path,
+				err,
+			)
+		}
+		defer inFile.Close()
+		src = inFile
 	}
-	defer inFile.Close()
 
-	// Seek to the correct position in the output file
-	if _, err := outFile.Seek(int64(fileInfo.dataOffset), io.SeekStart); err != nil {
+	hasher, err := b.HashAlgorithm.newHash()
+	if err != nil {
 		return fmt.Errorf(
-			"failed to seek in output file %s: %w",
-			fileInfo.path,
+			"failed to initialize hash for %s: %w",
+			fileInfo.label(),
 			err,
 		)
 	}
 
 	bytesWritten := uint64(0)
-	lastUpdateTime := time.Now()
-	total := float64(0)
-	totalUnit := ""
 
-	if b.ShowProgress {
-		total, totalUnit = formatSize(totalSize)
-	}
-
-	// Copy file data in chunks
+	// Copy entry data in chunks
 	for {
-		n, err := inFile.Read(buffer)
+		n, err := src.Read(buffer)
 		if err != nil && err != io.EOF {
 			return fmt.Errorf(
-				"error reading input file %s: %w",
-				fileInfo.path,
+				"error reading input %s: %w",
+				fileInfo.label(),
 				err,
 			)
 		}
@@ -307,92 +410,127 @@ func (b *Builder) copyFileToNSP(
 			break
 		}
 
-		if _, err := outFile.Write(buffer[:n]); err != nil {
-			return fmt.Errorf(
-				"error writing to output file %s: %w",
-				b.OutputPath,
-				err,
-			)
+		hasher.Write(buffer[:n])
+
+		if err := write(fileInfo.dataOffset+bytesWritten, buffer[:n]); err != nil {
+			return err
 		}
 
 		bytesWritten += uint64(n)
 		*processedSize += uint64(n)
 
-		if b.ShowProgress &&
-			time.Since(lastUpdateTime).
-				Milliseconds() >=
-				int64(
-					b.ProgressUpdateFrequency,
-				) {
-			b.drawProgressBar(*processedSize, totalSize, total, totalUnit, 50)
-			lastUpdateTime = time.Now()
+		if b.renderer != nil {
+			b.renderer.Update(fileInfo.name, progress.Line{
+				Action:  "packing",
+				Name:    fileInfo.name,
+				Current: bytesWritten,
+				Total:   fileInfo.size,
+			})
+			b.renderer.Update(totalLineID, progress.Line{
+				Action:  "packing",
+				Name:    "total",
+				Current: *processedSize,
+				Total:   totalSize,
+			})
 		}
 	}
 
+	if b.renderer != nil {
+		b.renderer.Done(fileInfo.name)
+	}
+
 	if bytesWritten != fileInfo.size {
 		return fmt.Errorf(
-			"size mismatch for file %s during write: expected %d bytes, wrote %d bytes",
-			fileInfo.path,
+			"size mismatch for %s during write: expected %d bytes, wrote %d bytes",
+			fileInfo.label(),
 			fileInfo.size,
 			bytesWritten,
 		)
 	}
 
+	fileInfo.digest = hasher.Sum(nil)
+
 	return nil
 }
 
-// clearLine clears the current line in the terminal
-func (b *Builder) clearLine() {
-	fmt.Print("\r" + strings.Repeat(" ", b.lastProgressWidth) + "\r")
-	b.lastProgressWidth = 0
+// partPath returns the filesystem path for the part file at the given index.
+// When splitting is disabled (SplitSize is zero), every index maps to the
+// single output file at OutputPath.
+func (b *Builder) partPath(index int) string {
+	if b.SplitSize == 0 {
+		return b.OutputPath
+	}
+	return fmt.Sprintf("%s.%02d", b.OutputPath, index)
 }
 
-// drawProgressBar displays a progress bar showing the current copying progress
-func (b *Builder) drawProgressBar(
-	currentSize uint64,
-	totalSize uint64,
-	total float64,
-	totalUnit string,
-	width int,
-) {
-	if !b.ShowProgress {
-		return
+// openPart returns the part file for the given index, creating it the first
+// time it is referenced.
+func (b *Builder) openPart(index int) (*os.File, error) {
+	if f, ok := b.partFiles[index]; ok {
+		return f, nil
 	}
 
-	if totalSize == 0 {
-		totalSize = 1 // Avoid division by zero
+	path := b.partPath(index)
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"failed to create output file %s: %w",
+			path,
+			err,
+		)
 	}
 
-	percent := float64(currentSize) / float64(totalSize)
-	filled := min(int(percent*float64(width)), width)
+	b.partFiles[index] = f
+	return f, nil
+}
 
-	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+// closePartFiles closes every part file opened during the current Build.
+func (b *Builder) closePartFiles() {
+	for _, f := range b.partFiles {
+		f.Close()
+	}
+}
 
-	current, currentUnit := formatSize(currentSize)
+// writeSpanning writes data at the given absolute offset within the logical
+// (unsplit) NSP, transparently rolling over to the next part file whenever
+// the write would cross the SplitSize boundary. The parts produced can be
+// concatenated back into the original, unsplit PFS0 layout. It is only used
+// by Build when it splits the output; BuildTo writes to a single sink instead.
+func (b *Builder) writeSpanning(offset uint64, data []byte) error {
+	for len(data) > 0 {
+		partIndex := int(offset / b.SplitSize)
+		partOffset := offset % b.SplitSize
+		remaining := b.SplitSize - partOffset
+
+		n := uint64(len(data))
+		if n > remaining {
+			n = remaining
+		}
 
-	progressString := fmt.Sprintf("\r[%s] %5.1f%% (%3.2f %s/%3.2f %s)",
-		bar,
-		percent*100,
-		current,
-		currentUnit,
-		total,
-		totalUnit,
-	)
-	b.clearLine()
-	fmt.Print(progressString)
-	b.lastProgressWidth = len(progressString)
-}
+		f, err := b.openPart(partIndex)
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Seek(int64(partOffset), io.SeekStart); err != nil {
+			return fmt.Errorf(
+				"failed to seek in output file %s: %w",
+				b.partPath(partIndex),
+				err,
+			)
+		}
 
-// formatSize converts a byte size to a human-readable format
-func formatSize(bytes uint64) (float64, string) {
-	units := []string{"B", "KB", "MB", "GB", "TB"}
-	size := float64(bytes)
-	unitIndex := 0
+		if _, err := f.Write(data[:n]); err != nil {
+			return fmt.Errorf(
+				"error writing to output file %s: %w",
+				b.partPath(partIndex),
+				err,
+			)
+		}
 
-	for size >= 1000 && unitIndex < len(units)-1 {
-		size /= 1000
-		unitIndex++
+		data = data[n:]
+		offset += n
 	}
 
-	return size, units[unitIndex]
+	return nil
 }
@@ -0,0 +1,89 @@
+package nsp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memWriteSeeker is a minimal in-memory io.WriteSeeker, standing in for the
+// kind of bytes.Buffer-style sink BuildTo is meant to support.
+type memWriteSeeker struct {
+	buf []byte
+	pos int64
+}
+
+func (w *memWriteSeeker) Write(p []byte) (int, error) {
+	end := w.pos + int64(len(p))
+	if end > int64(len(w.buf)) {
+		grown := make([]byte, end)
+		copy(grown, w.buf)
+		w.buf = grown
+	}
+	copy(w.buf[w.pos:end], p)
+	w.pos = end
+	return len(p), nil
+}
+
+func (w *memWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	var base int64
+	switch whence {
+	case io.SeekStart:
+		base = 0
+	case io.SeekCurrent:
+		base = w.pos
+	case io.SeekEnd:
+		base = int64(len(w.buf))
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	w.pos = base + offset
+	return w.pos, nil
+}
+
+func TestBuilderAddReaderBuildTo(t *testing.T) {
+	content := []byte("streamed entry content")
+
+	b := &Builder{BufferSize: DefaultBufferSize}
+	if err := b.AddReader("streamed.bin", uint64(len(content)), bytes.NewReader(content)); err != nil {
+		t.Fatalf("AddReader: %v", err)
+	}
+
+	sink := &memWriteSeeker{}
+	if err := b.BuildTo(sink); err != nil {
+		t.Fatalf("BuildTo: %v", err)
+	}
+
+	nspPath := filepath.Join(t.TempDir(), "out.nsp")
+	if err := os.WriteFile(nspPath, sink.buf, 0o644); err != nil {
+		t.Fatalf("failed to write NSP: %v", err)
+	}
+
+	r, err := OpenReader(nspPath)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer r.Close()
+
+	entries := r.Entries()
+	if len(entries) != 1 || entries[0].Name != "streamed.bin" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	rc, err := r.Open("streamed.bin")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+
+	got, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Fatalf("got %q, want %q", got, content)
+	}
+}
@@ -0,0 +1,196 @@
+package nsp
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Entry describes a single file stored inside an NSP, as exposed by Reader.
+type Entry struct {
+	// Filename as stored in the NSP
+	Name string
+
+	// Size of the file's data, in bytes
+	Size uint64
+
+	// Absolute offset of the file's data within the NSP
+	dataOffset uint64
+}
+
+// Reader provides read access to an existing PFS0/NSP file. It is the
+// inverse of Builder: where Builder writes an NSP from a set of input
+// files, Reader parses one back into its entries. It transparently handles
+// split output (OutputPath.00, .01, ...) the same way Verifier does.
+type Reader struct {
+	data    io.ReaderAt
+	closeFn func() error
+	entries []Entry
+}
+
+// OpenReader opens the NSP at path, or its sequentially numbered split parts
+// (path.00, path.01, ...) if no single file exists there, and parses its
+// PFS0 header.
+func OpenReader(path string) (*Reader, error) {
+	data, size, closeFn, err := openSplitOrSingle(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open NSP %s: %w", path, err)
+	}
+
+	dataBaseOffset, rawEntries, err := readPartitionEntries(
+		io.NewSectionReader(data, 0, size),
+	)
+	if err != nil {
+		closeFn()
+		return nil, fmt.Errorf("failed to parse NSP %s: %w", path, err)
+	}
+
+	entries := make([]Entry, len(rawEntries))
+	for i, e := range rawEntries {
+		dataOffset := dataBaseOffset + e.dataOffset
+		if dataOffset+e.size > uint64(size) {
+			closeFn()
+			return nil, fmt.Errorf(
+				"malformed NSP %s: entry %q extends beyond end of file",
+				path,
+				e.name,
+			)
+		}
+
+		entries[i] = Entry{
+			Name:       e.name,
+			Size:       e.size,
+			dataOffset: dataOffset,
+		}
+	}
+
+	return &Reader{data: data, closeFn: closeFn, entries: entries}, nil
+}
+
+// Entries returns the files stored in the NSP, in on-disk order.
+func (r *Reader) Entries() []Entry {
+	return r.entries
+}
+
+// Open returns a reader for the named entry's data. It is backed by an
+// io.SectionReader over the shared file handle, so entries returned by
+// separate calls to Open can be read concurrently without one seek
+// interfering with another. Entries stored with a ".ncz" suffix (written by
+// a Builder with Compression set to CompressionZstd) are transparently
+// decompressed.
+func (r *Reader) Open(name string) (io.ReadCloser, error) {
+	for _, e := range r.entries {
+		if e.Name != name {
+			continue
+		}
+
+		section := io.NewSectionReader(r.data, int64(e.dataOffset), int64(e.Size))
+
+		if !strings.HasSuffix(e.Name, ncaZstdSuffix) {
+			return io.NopCloser(section), nil
+		}
+
+		decoder, err := zstd.NewReader(section)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"failed to initialize zstd decoder for %s: %w",
+				name,
+				err,
+			)
+		}
+
+		return &zstdReadCloser{decoder: decoder}, nil
+	}
+
+	return nil, fmt.Errorf("no such entry %q", name)
+}
+
+// zstdReadCloser adapts a *zstd.Decoder, whose Close method does not return
+// an error, to io.ReadCloser.
+type zstdReadCloser struct {
+	decoder *zstd.Decoder
+}
+
+func (z *zstdReadCloser) Read(p []byte) (int, error) {
+	return z.decoder.Read(p)
+}
+
+func (z *zstdReadCloser) Close() error {
+	z.decoder.Close()
+	return nil
+}
+
+// ExtractAll writes every entry in the NSP to dir, preserving stored
+// filenames. dir is created if it does not already exist.
+func (r *Reader) ExtractAll(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf(
+			"failed to create output directory %s: %w",
+			dir,
+			err,
+		)
+	}
+
+	for _, e := range r.entries {
+		outPath, err := safeJoin(dir, e.Name)
+		if err != nil {
+			return fmt.Errorf("refusing to extract %q: %w", e.Name, err)
+		}
+
+		in, err := r.Open(e.Name)
+		if err != nil {
+			return err
+		}
+
+		out, err := os.Create(outPath)
+		if err != nil {
+			in.Close()
+			return fmt.Errorf(
+				"failed to create output file %s: %w",
+				outPath,
+				err,
+			)
+		}
+
+		_, copyErr := io.Copy(out, in)
+		in.Close()
+		closeErr := out.Close()
+
+		if copyErr != nil {
+			return fmt.Errorf("failed to extract %s: %w", e.Name, copyErr)
+		}
+		if closeErr != nil {
+			return fmt.Errorf(
+				"failed to close output file %s: %w",
+				outPath,
+				closeErr,
+			)
+		}
+	}
+
+	return nil
+}
+
+// Close closes the underlying NSP file(s).
+func (r *Reader) Close() error {
+	return r.closeFn()
+}
+
+// safeJoin joins dir and name, as stored in the NSP's string table, and
+// verifies the result stays within dir. This guards against a crafted entry
+// name such as "../../etc/passwd" escaping the intended output directory
+// during ExtractAll.
+func safeJoin(dir, name string) (string, error) {
+	joined := filepath.Join(dir, name)
+
+	rel, err := filepath.Rel(dir, joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry name %q escapes output directory", name)
+	}
+
+	return joined, nil
+}
@@ -0,0 +1,194 @@
+package nsp
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// rawPFS0 hand-assembles a minimal PFS0 file from the given entry names and
+// contents, bypassing Builder, so malformed headers can be constructed for
+// negative tests.
+func rawPFS0(t *testing.T, names []string, contents [][]byte) []byte {
+	t.Helper()
+
+	var stringTableSize int
+	for _, name := range names {
+		stringTableSize += len(name) + 1
+	}
+
+	headerMetadataSize := 0x10
+	partitionTableSize := len(names) * 0x18
+	headerSize := headerMetadataSize + partitionTableSize + stringTableSize
+	if remainder := headerSize % 0x10; remainder > 0 {
+		headerSize += 0x10 - remainder
+	}
+
+	header := make([]byte, headerSize)
+	copy(header[0:], PFS0Magic)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(names)))
+	// Like generateHeader, count the alignment padding in the string table.
+	binary.LittleEndian.PutUint32(header[8:], uint32(headerSize-headerMetadataSize-partitionTableSize))
+
+	pos := headerMetadataSize
+	stringOffset := uint32(0)
+	dataOffset := uint64(0)
+	for i, name := range names {
+		binary.LittleEndian.PutUint64(header[pos:], dataOffset)
+		binary.LittleEndian.PutUint64(header[pos+8:], uint64(len(contents[i])))
+		binary.LittleEndian.PutUint32(header[pos+16:], stringOffset)
+		pos += 0x18
+
+		stringOffset += uint32(len(name) + 1)
+		dataOffset += uint64(len(contents[i]))
+	}
+
+	stringTableOffset := headerMetadataSize + partitionTableSize
+	offset := stringTableOffset
+	for _, name := range names {
+		copy(header[offset:], name)
+		offset += len(name) + 1
+	}
+
+	var out []byte
+	out = append(out, header...)
+	for _, data := range contents {
+		out = append(out, data...)
+	}
+
+	return out
+}
+
+func writeTempNSP(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "test.nsp")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write NSP: %v", err)
+	}
+	return path
+}
+
+func TestBuilderReaderRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "a.bin")
+	if err := os.WriteFile(srcPath, []byte("hello world"), 0o644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	nspPath := filepath.Join(dir, "out.nsp")
+	b := &Builder{OutputPath: nspPath, BufferSize: DefaultBufferSize}
+	if err := b.AddFile(srcPath); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	r, err := OpenReader(nspPath)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer r.Close()
+
+	entries := r.Entries()
+	if len(entries) != 1 || entries[0].Name != "a.bin" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	rc, err := r.Open("a.bin")
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rc.Close()
+
+	buf := make([]byte, entries[0].Size)
+	if _, err := rc.Read(buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if string(buf) != "hello world" {
+		t.Fatalf("got %q, want %q", buf, "hello world")
+	}
+}
+
+func TestOpenReaderAcceptsSplitParts(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "a.bin")
+	content := make([]byte, 100)
+	if err := os.WriteFile(srcPath, content, 0o644); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	nspPath := filepath.Join(dir, "out.nsp")
+	b := &Builder{
+		OutputPath: nspPath,
+		BufferSize: DefaultBufferSize,
+		// Small enough that the entry's data spans several parts: the
+		// 48-byte header and the first 16 data bytes fill part .00.
+		SplitSize: 64,
+	}
+	if err := b.AddFile(srcPath); err != nil {
+		t.Fatalf("AddFile: %v", err)
+	}
+	if err := b.Build(); err != nil {
+		t.Fatalf("Build: %v", err)
+	}
+
+	if _, err := os.Stat(nspPath + ".00"); err != nil {
+		t.Fatalf("expected split part %s.00 to exist: %v", nspPath, err)
+	}
+
+	r, err := OpenReader(nspPath)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer r.Close()
+
+	outDir := filepath.Join(dir, "extracted")
+	if err := r.ExtractAll(outDir); err != nil {
+		t.Fatalf("ExtractAll: %v", err)
+	}
+
+	got, err := os.ReadFile(filepath.Join(outDir, "a.bin"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Fatalf("extracted content mismatch: got %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestExtractAllRejectsPathTraversal(t *testing.T) {
+	data := rawPFS0(t, []string{"../evil.txt"}, [][]byte{[]byte("x")})
+	nspPath := writeTempNSP(t, data)
+
+	r, err := OpenReader(nspPath)
+	if err != nil {
+		t.Fatalf("OpenReader: %v", err)
+	}
+	defer r.Close()
+
+	outDir := filepath.Join(filepath.Dir(nspPath), "out")
+	if err := r.ExtractAll(outDir); err == nil {
+		t.Fatal("expected ExtractAll to reject a path-traversal entry name")
+	}
+
+	if _, err := os.Stat(filepath.Join(filepath.Dir(outDir), "evil.txt")); !os.IsNotExist(err) {
+		t.Fatal("entry escaped the output directory")
+	}
+}
+
+func TestOpenReaderRejectsOutOfBoundsStringOffset(t *testing.T) {
+	data := rawPFS0(t, []string{"a.bin"}, [][]byte{[]byte("x")})
+
+	// Corrupt the sole entry's stringOffset (at 0x10+16) to point well past
+	// the end of the string table.
+	binary.LittleEndian.PutUint32(data[0x10+16:], 0xFFFFFFFF)
+
+	nspPath := writeTempNSP(t, data)
+
+	if _, err := OpenReader(nspPath); err == nil {
+		t.Fatal("expected OpenReader to reject an out-of-bounds string offset")
+	}
+}
@@ -0,0 +1,261 @@
+// Package progress provides a live, multi-line terminal progress renderer
+// for tracking several concurrent operations (e.g. packing, hashing, or
+// verifying files) alongside a trailing aggregate line.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// DefaultWidth is the bar width, in characters, used when the terminal width
+// cannot be detected.
+const DefaultWidth = 50
+
+// aggregateID is the key under which the trailing aggregate line is stored,
+// kept separate from the per-entry names passed to Update.
+const aggregateID = ""
+
+// Line describes the current state of a single tracked operation.
+type Line struct {
+	// Action being performed, shown as a prefix, e.g. "packing", "hashing",
+	// "verifying".
+	Action string
+
+	// Name of the file or entry this line tracks.
+	Name string
+
+	// Current and Total progress, in bytes.
+	Current, Total uint64
+}
+
+// Renderer draws a stable block of progress lines to a terminal: one line
+// per in-flight entry (added via Update) plus a trailing aggregate line, all
+// refreshed in place on each redraw. When standard output is not a terminal
+// (checked once by NewRenderer), it falls back to throttled plain-text
+// logging instead of cursor movement, so the
+// same calling code works unchanged in non-interactive contexts (CI logs,
+// redirected output, etc).
+type Renderer struct {
+	// Destination for rendered output. Defaults to os.Stdout.
+	Writer io.Writer
+
+	// Minimum time between redraws, in milliseconds.
+	UpdateFrequency int
+
+	// Width, in characters, of each line's bar. Detected from the terminal
+	// when zero and Writer is a TTY; falls back to DefaultWidth otherwise.
+	Width int
+
+	mu           sync.Mutex
+	isTerminal   bool
+	started      bool
+	lastDrawTime time.Time
+	drawnLines   int
+	order        []string
+	lines        map[string]Line
+}
+
+// NewRenderer creates a Renderer that writes to os.Stdout, redrawing at most
+// once every updateFrequency milliseconds.
+func NewRenderer(updateFrequency int) *Renderer {
+	return &Renderer{
+		Writer:          os.Stdout,
+		UpdateFrequency: updateFrequency,
+		isTerminal:      isTerminal(os.Stdout),
+		lines:           make(map[string]Line),
+	}
+}
+
+// Update records the current progress for the entry identified by id and
+// redraws if enough time has passed since the last redraw.
+func (r *Renderer) Update(id string, line Line) {
+	r.mu.Lock()
+	if _, ok := r.lines[id]; !ok {
+		r.order = append(r.order, id)
+	}
+	r.lines[id] = line
+	r.mu.Unlock()
+
+	r.draw(false)
+}
+
+// Done removes the entry identified by id, e.g. once a file has finished
+// copying. The aggregate line (tracked separately via Update with an empty
+// id) is unaffected.
+func (r *Renderer) Done(id string) {
+	r.mu.Lock()
+	delete(r.lines, id)
+	for i, existing := range r.order {
+		if existing == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	r.draw(false)
+}
+
+// Finish draws a final, unthrottled frame and marks the Renderer as no
+// longer occupying any terminal lines, so a subsequent Update starts a new
+// block instead of overwriting the old one.
+func (r *Renderer) Finish() {
+	r.draw(true)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.started = false
+	r.drawnLines = 0
+}
+
+// draw redraws every tracked line, subject to UpdateFrequency unless force
+// is set.
+func (r *Renderer) draw(force bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !force && time.Since(r.lastDrawTime).Milliseconds() < int64(r.UpdateFrequency) {
+		return
+	}
+	r.lastDrawTime = time.Now()
+
+	rows := r.rows()
+
+	if r.isTerminal {
+		r.drawLive(rows)
+	} else {
+		r.drawPlain(rows)
+	}
+}
+
+// rows returns the lines to render, in insertion order, with the aggregate
+// line (if present) moved to the end.
+func (r *Renderer) rows() []Line {
+	rows := make([]Line, 0, len(r.order)+1)
+	for _, id := range r.order {
+		if id == aggregateID {
+			continue
+		}
+		rows = append(rows, r.lines[id])
+	}
+	if total, ok := r.lines[aggregateID]; ok {
+		rows = append(rows, total)
+	}
+	return rows
+}
+
+// drawLive rewrites the block of tracked lines in place using ANSI cursor
+// movement, so concurrent operations never interleave their output.
+func (r *Renderer) drawLive(rows []Line) {
+	if r.started && r.drawnLines > 0 {
+		fmt.Fprintf(r.Writer, "\x1b[%dA", r.drawnLines)
+	}
+
+	width := r.Width
+	if width == 0 {
+		width = detectWidth(r.Writer)
+	}
+
+	for _, line := range rows {
+		fmt.Fprintf(r.Writer, "\x1b[2K\r%s\n", formatLine(line, width))
+	}
+
+	// If the block shrank since the last draw (e.g. Done removed a finished
+	// file's line), clear the now-stale rows left over below instead of
+	// leaving them on screen.
+	for i := len(rows); i < r.drawnLines; i++ {
+		fmt.Fprint(r.Writer, "\x1b[2K\r\n")
+	}
+	if r.drawnLines > len(rows) {
+		fmt.Fprintf(r.Writer, "\x1b[%dA", r.drawnLines-len(rows))
+	}
+
+	r.started = true
+	r.drawnLines = len(rows)
+}
+
+// drawPlain logs a single-line summary per entry instead of redrawing in
+// place, for use when Writer is not a terminal.
+func (r *Renderer) drawPlain(rows []Line) {
+	for _, line := range rows {
+		fmt.Fprintln(r.Writer, formatLine(line, DefaultWidth))
+	}
+}
+
+// formatLine renders a single Line as "<action> <name> [===   ] 42.0%
+// (1.23 MB/2.93 MB)".
+func formatLine(line Line, width int) string {
+	total := line.Total
+	if total == 0 {
+		total = 1 // Avoid division by zero
+	}
+
+	percent := float64(line.Current) / float64(total)
+	filled := min(int(percent*float64(width)), width)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+
+	current, currentUnit := formatSize(line.Current)
+	totalValue, totalUnit := formatSize(line.Total)
+
+	return fmt.Sprintf(
+		"%-10s %-30s [%s] %5.1f%% (%3.2f %s/%3.2f %s)",
+		line.Action,
+		line.Name,
+		bar,
+		percent*100,
+		current,
+		currentUnit,
+		totalValue,
+		totalUnit,
+	)
+}
+
+// formatSize converts a byte size to a human-readable value and unit.
+func formatSize(bytes uint64) (float64, string) {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(bytes)
+	unitIndex := 0
+
+	for size >= 1000 && unitIndex < len(units)-1 {
+		size /= 1000
+		unitIndex++
+	}
+
+	return size, units[unitIndex]
+}
+
+// isTerminal reports whether w is connected to a terminal.
+func isTerminal(w *os.File) bool {
+	return term.IsTerminal(int(w.Fd()))
+}
+
+// detectWidth returns the terminal width to use for bars, falling back to
+// DefaultWidth when it cannot be determined (e.g. w is not a *os.File or not
+// a terminal).
+func detectWidth(w io.Writer) int {
+	f, ok := w.(*os.File)
+	if !ok {
+		return DefaultWidth
+	}
+
+	width, _, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 {
+		return DefaultWidth
+	}
+
+	// Leave room for the action/name/percentage/size columns around the bar.
+	barWidth := width - 60
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	return barWidth
+}
@@ -0,0 +1,36 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// countClears returns the number of "clear current line" ANSI sequences
+// ("\x1b[2K") present in s.
+func countClears(s string) int {
+	return strings.Count(s, "\x1b[2K")
+}
+
+func TestDrawLiveClearsStaleLinesWhenBlockShrinks(t *testing.T) {
+	var buf bytes.Buffer
+	r := &Renderer{Writer: &buf, isTerminal: true, lines: make(map[string]Line)}
+
+	r.drawLive([]Line{{Name: "a"}, {Name: "b"}})
+	if r.drawnLines != 2 {
+		t.Fatalf("drawnLines = %d, want 2", r.drawnLines)
+	}
+
+	buf.Reset()
+	r.drawLive([]Line{{Name: "b"}})
+
+	if r.drawnLines != 1 {
+		t.Fatalf("drawnLines = %d, want 1", r.drawnLines)
+	}
+
+	// One clear for the redrawn "b" line, one more for the stale leftover
+	// line from the previous, longer block.
+	if got := countClears(buf.String()); got != 2 {
+		t.Fatalf("expected the leftover line to be cleared, got %d clear sequences in %q", got, buf.String())
+	}
+}